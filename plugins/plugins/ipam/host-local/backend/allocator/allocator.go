@@ -0,0 +1,257 @@
+// Copyright 2015 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package allocator
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/containernetworking/cni/pkg/types/current"
+)
+
+// Store is the interface that every host-local backend (disk, bolt, ...)
+// must implement so an IPAllocator can reserve and release IPs through it.
+type Store interface {
+	Lock() error
+	Unlock() error
+	Close() error
+	Reserve(id string, ifname string, ip net.IP, rangeID string) (bool, error)
+	LastReservedIP(rangeID string) (net.IP, error)
+	Release(ip net.IP) error
+	ReleaseByID(id string, ifname string) error
+	// FindByID returns true if the store has at least one IP reserved
+	// for the given (id, ifname) pair, regardless of range.
+	FindByID(id string, ifname string) bool
+	// GetByID returns every IP currently reserved for the given
+	// (id, ifname) pair.
+	GetByID(id string, ifname string) []net.IP
+	// GetReservations returns every reservation currently held by the
+	// store, across all ranges. Used by GC to find reservations whose
+	// owner is no longer live.
+	GetReservations() ([]Reservation, error)
+}
+
+// Reservation is a single (IP, ContainerID, IfName) entry held by a
+// Store, as returned by GetReservations.
+type Reservation struct {
+	IP          net.IP
+	ContainerID string
+	IfName      string
+}
+
+// AutoAllocator is implemented by stores whose authoritative pool state
+// lives elsewhere (e.g. a shared remote service), so they can pick the
+// next free IP for (id, ifname) in rangeID themselves. Get uses this in
+// place of its local rangeIter loop whenever the Store supports it: for
+// a pool shared across nodes, guessing candidates from this node's own
+// possibly-stale cursor just means round-tripping through every address
+// someone else already took. ReserveNext returns a nil IP, without
+// error, if rangeID is exhausted.
+type AutoAllocator interface {
+	ReserveNext(id string, ifname string, rangeID string) (ip net.IP, gw net.IP, err error)
+}
+
+// IPAllocator allocates and releases IPs out of a single RangeSet, backed
+// by a Store.
+type IPAllocator struct {
+	rangeset *RangeSet
+	store    Store
+	rangeID  string // Used for tracking last reserved IP per range set
+}
+
+// NewIPAllocator creates a new IPAllocator for the given RangeSet, which
+// will back onto the given Store. The rangeIdx identifies which of the
+// (possibly several) ranges configured for this network this allocator
+// is responsible for.
+func NewIPAllocator(s *RangeSet, store Store, rangeIdx int) *IPAllocator {
+	return &IPAllocator{
+		rangeset: s,
+		store:    store,
+		rangeID:  fmt.Sprintf("%d", rangeIdx),
+	}
+}
+
+// Get allocates an IP for the given (id, ifname) pair, either the
+// requestedIP if one was given, or the next free IP in the range.
+//
+// Per the CNI spec, ADD must be idempotent: if the (id, ifname) pair
+// already holds a reservation in this range, that reservation is
+// returned unchanged instead of erroring or allocating a second IP.
+func (a *IPAllocator) Get(id string, ifname string, requestedIP net.IP) (*current.IPConfig, error) {
+	a.store.Lock()
+	defer a.store.Unlock()
+
+	if reserved := a.store.GetByID(id, ifname); len(reserved) > 0 {
+		for _, ip := range reserved {
+			if canonical, r := a.rangeset.RangeFor(ip); r != nil {
+				return a.ipConfig(canonical, r), nil
+			}
+		}
+	}
+
+	var reservedIP net.IP
+	var gw net.IP
+
+	if requestedIP != nil {
+		if requestedIP.To4() == nil {
+			requestedIP = requestedIP.To16()
+		}
+		canonical, r := a.rangeset.RangeFor(requestedIP)
+		if r == nil {
+			return nil, fmt.Errorf("requested IP %s not in range set %s", requestedIP, a.rangeset)
+		}
+		if canonical.Equal(r.Gateway) {
+			return nil, fmt.Errorf("requested IP %s is the gateway for range set %s", requestedIP, a.rangeset)
+		}
+		reserved, err := a.store.Reserve(id, ifname, canonical, a.rangeID)
+		if err != nil {
+			return nil, err
+		}
+		if !reserved {
+			return nil, fmt.Errorf("requested IP address %s is not available in range set %s", requestedIP, a.rangeset)
+		}
+		reservedIP = canonical
+		gw = r.Gateway
+	} else if auto, ok := a.store.(AutoAllocator); ok {
+		ip, gwip, err := auto.ReserveNext(id, ifname, a.rangeID)
+		if err != nil {
+			return nil, err
+		}
+		if ip == nil || a.rangeFor(ip) == nil {
+			return nil, fmt.Errorf("no IP addresses available in range set: %s", a.rangeset)
+		}
+		reservedIP = ip
+		gw = gwip
+	} else {
+		iter, err := a.GetIter()
+		if err != nil {
+			return nil, err
+		}
+		for {
+			ip, r := iter.Next()
+			if ip == nil {
+				return nil, fmt.Errorf("no IP addresses available in range set: %s", a.rangeset)
+			}
+			reserved, err := a.store.Reserve(id, ifname, ip, a.rangeID)
+			if err != nil {
+				return nil, err
+			}
+			if reserved {
+				reservedIP = ip
+				gw = r.Gateway
+				break
+			}
+		}
+	}
+
+	return a.ipConfig(reservedIP, &Range{Gateway: gw, Subnet: a.rangeFor(reservedIP).Subnet}), nil
+}
+
+// Release releases all IPs reserved for the given (id, ifname) pair.
+// The store's ReleaseByID is not limited to this allocator's range, so
+// the pair's reservations in every range are freed.
+func (a *IPAllocator) Release(id string, ifname string) error {
+	a.store.Lock()
+	defer a.store.Unlock()
+
+	return a.store.ReleaseByID(id, ifname)
+}
+
+func (a *IPAllocator) rangeFor(ip net.IP) *Range {
+	_, r := a.rangeset.RangeFor(ip)
+	return r
+}
+
+func (a *IPAllocator) ipConfig(ip net.IP, r *Range) *current.IPConfig {
+	version := "4"
+	if ip.To4() == nil {
+		version = "6"
+	}
+	return &current.IPConfig{
+		Version: version,
+		Address: net.IPNet{IP: ip, Mask: r.Subnet.Mask},
+		Gateway: r.Gateway,
+	}
+}
+
+// rangeIter iterates sequentially over every IP in a RangeSet, starting
+// just after the last IP that was reserved for the relevant rangeID.
+type rangeIter struct {
+	rangeset *RangeSet
+	cur      net.IP
+	rangeIdx int
+	// startIP is the first IP returned by Next, recorded so a second
+	// pass through the whole RangeSet can be detected and stopped
+	// instead of looping forever.
+	startIP net.IP
+}
+
+// GetIter returns a fresh iterator positioned right after the last IP
+// reserved for this allocator's range, wrapping back to the start of the
+// RangeSet once the end is reached. A nil cur means no candidate has
+// been offered yet, so the first call to Next returns RangeStart itself
+// rather than the address after it.
+func (a *IPAllocator) GetIter() (*rangeIter, error) {
+	last, err := a.store.LastReservedIP(a.rangeID)
+	if err != nil || last == nil {
+		return &rangeIter{rangeset: a.rangeset, rangeIdx: 0}, nil
+	}
+
+	for idx, r := range *a.rangeset {
+		if r.Contains(last) {
+			return &rangeIter{rangeset: a.rangeset, cur: last, rangeIdx: idx}, nil
+		}
+	}
+	return &rangeIter{rangeset: a.rangeset, rangeIdx: 0}, nil
+}
+
+// Next returns the next candidate IP (and the Range it belongs to) after
+// the iterator's current position, skipping each range's own gateway
+// address (it's already taken, by definition), or (nil, nil) once every
+// IP in the set has been visited once.
+func (i *rangeIter) Next() (net.IP, *Range) {
+	for {
+		r := &(*i.rangeset)[i.rangeIdx]
+
+		var next net.IP
+		if i.cur == nil {
+			// No candidate offered yet in this range: start at
+			// RangeStart itself instead of the address after it.
+			next = r.RangeStart
+		} else {
+			next = nextIP(i.cur)
+			if ipLess(r.RangeEnd, next) {
+				i.rangeIdx = (i.rangeIdx + 1) % len(*i.rangeset)
+				r = &(*i.rangeset)[i.rangeIdx]
+				next = r.RangeStart
+			}
+		}
+		i.cur = next
+
+		if next.Equal(r.Gateway) {
+			continue
+		}
+
+		if i.startIP == nil {
+			i.startIP = next
+		} else if next.Equal(i.startIP) {
+			// Back to the first candidate we ever offered: every IP in
+			// the RangeSet has been tried once.
+			return nil, nil
+		}
+
+		return next, r
+	}
+}
@@ -0,0 +1,169 @@
+// Copyright 2015 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package allocator
+
+import (
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/containernetworking/cni/pkg/types"
+)
+
+// fakeStore is a minimal in-memory Store, just enough to drive
+// IPAllocator/rangeIter without touching disk.
+type fakeStore struct {
+	reservations []Reservation
+	last         map[string]net.IP // rangeID -> last reserved IP
+}
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{last: map[string]net.IP{}}
+}
+
+func (s *fakeStore) Lock() error   { return nil }
+func (s *fakeStore) Unlock() error { return nil }
+func (s *fakeStore) Close() error  { return nil }
+
+func (s *fakeStore) Reserve(id string, ifname string, ip net.IP, rangeID string) (bool, error) {
+	for _, r := range s.reservations {
+		if r.IP.Equal(ip) {
+			return false, nil
+		}
+	}
+	s.reservations = append(s.reservations, Reservation{IP: ip, ContainerID: id, IfName: ifname})
+	s.last[rangeID] = ip
+	return true, nil
+}
+
+func (s *fakeStore) LastReservedIP(rangeID string) (net.IP, error) {
+	return s.last[rangeID], nil
+}
+
+func (s *fakeStore) Release(ip net.IP) error {
+	for i, r := range s.reservations {
+		if r.IP.Equal(ip) {
+			s.reservations = append(s.reservations[:i], s.reservations[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (s *fakeStore) ReleaseByID(id string, ifname string) error {
+	var kept []Reservation
+	for _, r := range s.reservations {
+		if r.ContainerID == id && r.IfName == ifname {
+			continue
+		}
+		kept = append(kept, r)
+	}
+	s.reservations = kept
+	return nil
+}
+
+func (s *fakeStore) FindByID(id string, ifname string) bool {
+	return len(s.GetByID(id, ifname)) > 0
+}
+
+func (s *fakeStore) GetByID(id string, ifname string) []net.IP {
+	var ips []net.IP
+	for _, r := range s.reservations {
+		if r.ContainerID == id && r.IfName == ifname {
+			ips = append(ips, r.IP)
+		}
+	}
+	return ips
+}
+
+func (s *fakeStore) GetReservations() ([]Reservation, error) {
+	return s.reservations, nil
+}
+
+func testRangeSet(t *testing.T) *RangeSet {
+	t.Helper()
+
+	_, subnet, err := net.ParseCIDR("192.0.2.0/29")
+	if err != nil {
+		t.Fatalf("ParseCIDR: %v", err)
+	}
+	r := Range{Subnet: types.IPNet(*subnet)}
+	if err := r.Canonicalize(); err != nil {
+		t.Fatalf("Canonicalize: %v", err)
+	}
+	return &RangeSet{r}
+}
+
+// On a fresh 192.0.2.0/29, Canonicalize defaults both RangeStart and
+// Gateway to net+1 (192.0.2.1), so the pool is: .1 (gateway, excluded),
+// .2-.6 usable, .7 (broadcast, excluded by RangeEnd).
+func TestIPAllocatorGetSkipsFirstAllocationPastGateway(t *testing.T) {
+	rangeset := testRangeSet(t)
+	store := newFakeStore()
+	alloc := NewIPAllocator(rangeset, store, 0)
+
+	cfg, err := alloc.Get("container1", "eth0", nil)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+
+	// RangeStart is the gateway itself on a fresh /29 (Canonicalize
+	// defaults both RangeStart and Gateway to net+1), so the very first
+	// address handed out must be net+2, not the gateway.
+	want := net.ParseIP("192.0.2.2").To4()
+	if !cfg.Address.IP.Equal(want) {
+		t.Fatalf("first allocated IP = %s, want %s", cfg.Address.IP, want)
+	}
+}
+
+func TestIPAllocatorGetNeverAllocatesGateway(t *testing.T) {
+	rangeset := testRangeSet(t)
+	store := newFakeStore()
+	alloc := NewIPAllocator(rangeset, store, 0)
+
+	gw := (*rangeset)[0].Gateway
+	for i := 0; i < 10; i++ {
+		cfg, err := alloc.Get(containerID(i), "eth0", nil)
+		if err != nil {
+			// Expected once the small range is exhausted.
+			break
+		}
+		if cfg.Address.IP.Equal(gw) {
+			t.Fatalf("Get returned the gateway address %s as an allocation", gw)
+		}
+	}
+}
+
+func TestIPAllocatorGetIsIdempotent(t *testing.T) {
+	rangeset := testRangeSet(t)
+	store := newFakeStore()
+	alloc := NewIPAllocator(rangeset, store, 0)
+
+	first, err := alloc.Get("container1", "eth0", nil)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	second, err := alloc.Get("container1", "eth0", nil)
+	if err != nil {
+		t.Fatalf("Get (retry): %v", err)
+	}
+	if !first.Address.IP.Equal(second.Address.IP) {
+		t.Fatalf("retried Get returned a different IP: %s vs %s", first.Address.IP, second.Address.IP)
+	}
+}
+
+func containerID(i int) string {
+	return fmt.Sprintf("container%d", i)
+}
@@ -0,0 +1,141 @@
+// Copyright 2015 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package allocator
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+
+	"github.com/containernetworking/cni/pkg/types"
+)
+
+// IPAMConfig describes the expected json configuration for this plugin.
+// It reflects the "ipam" block of a CNI NetConf.
+type IPAMConfig struct {
+	Name       string
+	Type       string         `json:"type"`
+	Routes     []*types.Route `json:"routes"`
+	ResolvConf string         `json:"resolvConf"`
+	DataDir    string         `json:"dataDir"`
+	// Backend selects the Store implementation used to persist
+	// reservations: "disk" (default, one file per IP) or "bolt" (a
+	// single bolt.db file with per-network buckets).
+	Backend string `json:"backend,omitempty"`
+	// LogFile is where structured logs are written; "" (the default)
+	// logs to stderr instead of a fixed /var/log path, so the plugin
+	// keeps working on read-only root filesystems.
+	LogFile string `json:"logFile,omitempty"`
+	// LogLevel is one of "error", "info" (default) or "debug".
+	LogLevel string `json:"logLevel,omitempty"`
+	// LogFormat is "text" (default) or "json".
+	LogFormat string `json:"logFormat,omitempty"`
+	// LogMaxSize rotates LogFile once it grows past this many bytes.
+	// Zero disables rotation.
+	LogMaxSize int64 `json:"logMaxSize,omitempty"`
+	// GCOnAdd enables releasing stale reservations on ADD: any
+	// reservation whose (ContainerID, IfName) isn't in the runtime's
+	// live set (see LiveSandboxesFile and the K8S_LIVE_SANDBOXES CNI
+	// arg) is freed before a new IP is allocated.
+	GCOnAdd bool `json:"gcOnAdd,omitempty"`
+	// LiveSandboxesFile, if set, points at a JSON file the runtime
+	// writes containing the current live set (an array of
+	// {"containerID":"...","ifname":"..."} objects) for GCOnAdd to
+	// read. Takes precedence over the K8S_LIVE_SANDBOXES CNI arg.
+	LiveSandboxesFile string `json:"liveSandboxesFile,omitempty"`
+	// Remote, if set (at minimum its Endpoint), delegates allocation to
+	// an external gRPC IPAM service instead of a local Store, so every
+	// node sharing this network draws from one pool.
+	Remote *RemoteConfig `json:"remote,omitempty"`
+	Ranges []RangeSet    `json:"ranges"`
+	IPArgs []net.IP      `json:"-"` // Requested IPs from CNI_ARGS and args
+}
+
+// RemoteConfig is the "ipam.remote" block.
+type RemoteConfig struct {
+	Endpoint string `json:"endpoint"`
+	// TLSCACert, TLSCert and TLSKey enable TLS (and, with both
+	// TLSCert/TLSKey set, mTLS) towards Endpoint.
+	TLSCACert string `json:"tlsCACert,omitempty"`
+	TLSCert   string `json:"tlsCert,omitempty"`
+	TLSKey    string `json:"tlsKey,omitempty"`
+}
+
+// IPAMEnvArgs describes IP-related parameters that can be passed to the
+// plugin via CNI_ARGS, e.g. CNI_ARGS="IP=192.0.2.3".
+type IPAMEnvArgs struct {
+	types.CommonArgs
+	IP net.IP `json:"ip,omitempty"`
+	// K8S_LIVE_SANDBOXES carries a JSON-encoded []LiveContainer, used by
+	// GCOnAdd when LiveSandboxesFile isn't set. types.LoadArgs matches
+	// CNI_ARGS keys against field names, so the field carries the arg's
+	// exact name.
+	K8S_LIVE_SANDBOXES types.UnmarshallableString `json:"K8S_LIVE_SANDBOXES,omitempty"`
+}
+
+// NetConf is the full network configuration, as passed to the plugin on
+// stdin, with the "ipam" block parsed out.
+type NetConf struct {
+	Name       string      `json:"name,omitempty"`
+	CNIVersion string      `json:"cniVersion,omitempty"`
+	IPAM       *IPAMConfig `json:"ipam"`
+}
+
+// LoadIPAMConfig parses the IPAM section of a CNI config, merging in any
+// IP addresses requested via CNI_ARGS or the "args" section of the
+// config, and returns the resulting IPAMConfig and CNIVersion.
+func LoadIPAMConfig(bytes []byte, envArgs string) (*IPAMConfig, string, error) {
+	n := NetConf{}
+	if err := json.Unmarshal(bytes, &n); err != nil {
+		return nil, "", err
+	}
+
+	if n.IPAM == nil {
+		return nil, "", fmt.Errorf("IPAM config missing 'ipam' key")
+	}
+
+	// Parse custom IP from environment variable
+	var e IPAMEnvArgs
+	if envArgs != "" {
+		err := types.LoadArgs(envArgs, &e)
+		if err != nil {
+			return nil, "", err
+		}
+
+		if e.IP != nil {
+			n.IPAM.IPArgs = append(n.IPAM.IPArgs, e.IP)
+		}
+	}
+
+	for idx := range n.IPAM.Ranges {
+		if err := n.IPAM.Ranges[idx].Canonicalize(); err != nil {
+			return nil, "", fmt.Errorf("invalid range set %d: %v", idx, err)
+		}
+	}
+
+	n.IPAM.Name = n.Name
+
+	if n.IPAM.Backend == "" {
+		n.IPAM.Backend = "disk"
+	} else if n.IPAM.Backend != "disk" && n.IPAM.Backend != "bolt" {
+		return nil, "", fmt.Errorf("unknown ipam backend %q", n.IPAM.Backend)
+	}
+
+	if n.IPAM.Remote != nil && n.IPAM.Remote.Endpoint == "" {
+		return nil, "", fmt.Errorf("ipam.remote requires an endpoint")
+	}
+
+	return n.IPAM, n.CNIVersion, nil
+}
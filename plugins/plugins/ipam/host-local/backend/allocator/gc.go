@@ -0,0 +1,127 @@
+// Copyright 2015 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package allocator
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/containernetworking/cni/pkg/types"
+)
+
+// LiveContainer identifies a (ContainerID, IfName) pair that the
+// container runtime still considers alive. It is the input to GC: any
+// on-disk reservation that isn't in the live set is assumed to belong
+// to a sandbox whose DEL was never run (e.g. the runtime crashed) and
+// is released.
+type LiveContainer struct {
+	ContainerID string `json:"containerID"`
+	IfName      string `json:"ifname"`
+}
+
+// LoadLiveContainers resolves the runtime's live set for GCOnAdd:
+// ipamConf.LiveSandboxesFile if set, otherwise the K8S_LIVE_SANDBOXES
+// CNI arg, otherwise an empty (nothing is live) set.
+func LoadLiveContainers(ipamConf *IPAMConfig, envArgs string) ([]LiveContainer, error) {
+	if ipamConf.LiveSandboxesFile != "" {
+		data, err := os.ReadFile(ipamConf.LiveSandboxesFile)
+		if err != nil {
+			return nil, err
+		}
+		var live []LiveContainer
+		if err := json.Unmarshal(data, &live); err != nil {
+			return nil, err
+		}
+		return live, nil
+	}
+
+	if envArgs == "" {
+		return nil, nil
+	}
+
+	var e IPAMEnvArgs
+	if err := types.LoadArgs(envArgs, &e); err != nil {
+		return nil, err
+	}
+	if e.K8S_LIVE_SANDBOXES == "" {
+		return nil, nil
+	}
+
+	var live []LiveContainer
+	if err := json.Unmarshal([]byte(e.K8S_LIVE_SANDBOXES), &live); err != nil {
+		return nil, err
+	}
+	return live, nil
+}
+
+// GC releases every reservation in this allocator's range whose
+// (ContainerID, IfName) is not present in live, except (selfID,
+// selfIfname) itself. It is meant to run before Get on ADD, so a node
+// that has accumulated leaked reservations (because kubelet/containerd
+// skipped DEL) reclaims them without an operator manually clearing the
+// data dir.
+//
+// selfID/selfIfname must always be excluded: the live set is an
+// out-of-band snapshot (a file or CNI arg the runtime wrote separately
+// from this ADD) and can lag behind the very request calling GC, so a
+// momentarily-stale snapshot must never be allowed to evict the
+// reservation this ADD is in the middle of making idempotent.
+func (a *IPAllocator) GC(live []LiveContainer, selfID string, selfIfname string) error {
+	a.store.Lock()
+	defer a.store.Unlock()
+
+	liveSet := make(map[LiveContainer]bool, len(live))
+	for _, c := range live {
+		liveSet[c] = true
+	}
+
+	reservations, err := a.store.GetReservations()
+	if err != nil {
+		return err
+	}
+
+	// Release every stale reservation even if one backend call fails or
+	// is slow (e.g. a remote ReleaseByID RPC): one bad entry shouldn't
+	// leave the rest leaked, and on a remote Store this loop runs with
+	// a.store's local lock held, so it shouldn't give up early and let
+	// that lock be held for nothing.
+	var errs []string
+	for _, r := range reservations {
+		if !a.rangeset.Contains(r.IP) {
+			continue
+		}
+		if r.ContainerID == selfID && r.IfName == selfIfname {
+			continue
+		}
+		if liveSet[LiveContainer{ContainerID: r.ContainerID, IfName: r.IfName}] {
+			continue
+		}
+		// ReleaseByID, not Release(r.IP): a bare IP release only ever
+		// means "forget this address" to backends (like remote) whose
+		// authoritative store is keyed by (ContainerID, IfName), not by
+		// address. Releasing by ID is what actually frees the
+		// reservation there instead of just dropping a local mirror.
+		if err := a.store.ReleaseByID(r.ContainerID, r.IfName); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	if errs != nil {
+		return fmt.Errorf(strings.Join(errs, ";"))
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+// Copyright 2015 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package allocator
+
+import (
+	"net"
+	"testing"
+)
+
+func TestGCReleasesOnlyDeadReservations(t *testing.T) {
+	rangeset := testRangeSet(t)
+	store := newFakeStore()
+	alloc := NewIPAllocator(rangeset, store, 0)
+
+	store.reservations = []Reservation{
+		{IP: net.ParseIP("192.0.2.2"), ContainerID: "dead", IfName: "eth0"},
+		{IP: net.ParseIP("192.0.2.3"), ContainerID: "live", IfName: "eth0"},
+		{IP: net.ParseIP("192.0.2.4"), ContainerID: "self", IfName: "eth0"},
+	}
+
+	live := []LiveContainer{{ContainerID: "live", IfName: "eth0"}}
+	if err := alloc.GC(live, "self", "eth0"); err != nil {
+		t.Fatalf("GC: %v", err)
+	}
+
+	if store.FindByID("dead", "eth0") {
+		t.Fatal("GC left a reservation behind for a container not in the live set")
+	}
+	if !store.FindByID("live", "eth0") {
+		t.Fatal("GC released a reservation for a container in the live set")
+	}
+	if !store.FindByID("self", "eth0") {
+		t.Fatal("GC evicted the in-flight ADD's own reservation (self, eth0), which must always be excluded")
+	}
+}
+
+func TestGCIgnoresReservationsOutsideItsRange(t *testing.T) {
+	rangeset := testRangeSet(t)
+	store := newFakeStore()
+	alloc := NewIPAllocator(rangeset, store, 0)
+
+	store.reservations = []Reservation{
+		{IP: net.ParseIP("203.0.113.5"), ContainerID: "other-range", IfName: "eth0"},
+	}
+
+	if err := alloc.GC(nil, "self", "eth0"); err != nil {
+		t.Fatalf("GC: %v", err)
+	}
+
+	if !store.FindByID("other-range", "eth0") {
+		t.Fatal("GC released a reservation outside its own RangeSet")
+	}
+}
@@ -0,0 +1,162 @@
+// Copyright 2015 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package allocator
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+
+	"github.com/containernetworking/cni/pkg/types"
+)
+
+// Range is a range of IPs and their associated subnet and gateway, as read
+// straight off the wire in the IPAM config.
+type Range struct {
+	RangeStart net.IP      `json:"rangeStart,omitempty"` // The first ip, inclusive
+	RangeEnd   net.IP      `json:"rangeEnd,omitempty"`   // The last ip, inclusive
+	Subnet     types.IPNet `json:"subnet"`
+	Gateway    net.IP      `json:"gateway,omitempty"`
+}
+
+// Canonicalize takes a given range and ensures that all information is
+// consistent, filling out Start and End if necessary.
+func (r *Range) Canonicalize() error {
+	if r.Subnet.IP == nil {
+		return fmt.Errorf("missing field %q", "subnet")
+	}
+
+	// Can't create an allocator for a network with no addresses, eg
+	// a /32 or /31
+	ones, masklen := r.Subnet.Mask.Size()
+	if masklen-ones < 2 {
+		return fmt.Errorf("network %s too small to allocate from", (net.IPNet)(r.Subnet).String())
+	}
+
+	if r.RangeStart == nil {
+		r.RangeStart = networkAddr(&r.Subnet)
+		r.RangeStart = nextIP(r.RangeStart)
+	}
+	if !r.Subnet.Contains(r.RangeStart) {
+		return fmt.Errorf("rangeStart %s not in network %s", r.RangeStart, (net.IPNet)(r.Subnet).String())
+	}
+
+	if r.RangeEnd == nil {
+		r.RangeEnd = broadcastAddr(&r.Subnet)
+		r.RangeEnd = prevIP(r.RangeEnd)
+	}
+	if !r.Subnet.Contains(r.RangeEnd) {
+		return fmt.Errorf("rangeEnd %s not in network %s", r.RangeEnd, (net.IPNet)(r.Subnet).String())
+	}
+
+	if r.Gateway == nil {
+		r.Gateway = networkAddr(&r.Subnet)
+		r.Gateway = nextIP(r.Gateway)
+	}
+
+	return nil
+}
+
+// Contains tests whether a given IP falls within this range
+func (r *Range) Contains(addr net.IP) bool {
+	if err := canonicalizeIP(&addr); err != nil {
+		return false
+	}
+
+	// Not within the subnet at all
+	if !r.Subnet.Contains(addr) {
+		return false
+	}
+
+	// Not within the range
+	if ipLess(addr, r.RangeStart) || ipLess(r.RangeEnd, addr) {
+		return false
+	}
+
+	return true
+}
+
+func (r *Range) String() string {
+	if r == nil {
+		return ""
+	}
+	b, _ := json.Marshal(r)
+	return string(b)
+}
+
+func ipLess(a, b net.IP) bool {
+	a16, b16 := a.To16(), b.To16()
+	if a16 == nil || b16 == nil {
+		return false
+	}
+	for i := range a16 {
+		if a16[i] != b16[i] {
+			return a16[i] < b16[i]
+		}
+	}
+	return false
+}
+
+func canonicalizeIP(ip *net.IP) error {
+	if ip.To4() != nil {
+		*ip = ip.To4()
+		return nil
+	} else if ip.To16() != nil {
+		*ip = ip.To16()
+		return nil
+	}
+	return fmt.Errorf("IP %s not v4 nor v6", *ip)
+}
+
+func networkAddr(n *types.IPNet) net.IP {
+	masked := n.IP.Mask(n.Mask)
+	out := make(net.IP, len(masked))
+	copy(out, masked)
+	return out
+}
+
+func broadcastAddr(n *types.IPNet) net.IP {
+	broadcast := make(net.IP, len(n.IP))
+	mask := n.Mask
+	base := n.IP.Mask(mask)
+	for i := range base {
+		broadcast[i] = base[i] | ^mask[i]
+	}
+	return broadcast
+}
+
+func nextIP(ip net.IP) net.IP {
+	out := make(net.IP, len(ip))
+	copy(out, ip)
+	for i := len(out) - 1; i >= 0; i-- {
+		out[i]++
+		if out[i] != 0 {
+			break
+		}
+	}
+	return out
+}
+
+func prevIP(ip net.IP) net.IP {
+	out := make(net.IP, len(ip))
+	copy(out, ip)
+	for i := len(out) - 1; i >= 0; i-- {
+		out[i]--
+		if out[i] != 0xff {
+			break
+		}
+	}
+	return out
+}
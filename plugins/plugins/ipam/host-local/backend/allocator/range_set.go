@@ -0,0 +1,84 @@
+// Copyright 2015 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package allocator
+
+import (
+	"fmt"
+	"net"
+)
+
+// RangeSet is a list of Ranges that share a single rangeID; all ranges
+// in a RangeSet are considered part of the same pool for allocation
+// purposes.
+type RangeSet []Range
+
+// Canonicalize ensures the RangeSet is consistent, i.e. the Subnets do
+// not overlap and that all fields are well-formed.
+func (s *RangeSet) Canonicalize() error {
+	if len(*s) == 0 {
+		return fmt.Errorf("empty range set")
+	}
+
+	fam := 0
+	for i := range *s {
+		r := &(*s)[i]
+		if err := r.Canonicalize(); err != nil {
+			return err
+		}
+
+		rfam := 4
+		if r.Subnet.IP.To4() == nil {
+			rfam = 6
+		}
+		if fam == 0 {
+			fam = rfam
+		} else if fam != rfam {
+			return fmt.Errorf("mixed IPv4/IPv6 in single range set")
+		}
+	}
+
+	for i, r1 := range *s {
+		for _, r2 := range (*s)[i+1:] {
+			if r1.Subnet.Contains(r2.RangeStart) || r1.Subnet.Contains(r2.RangeEnd) ||
+				r2.Subnet.Contains(r1.RangeStart) || r2.Subnet.Contains(r1.RangeEnd) {
+				return fmt.Errorf("subnets %s and %s overlap", r1.Subnet.String(), r2.Subnet.String())
+			}
+		}
+	}
+
+	return nil
+}
+
+// Contains returns true if any Range in the set contains ip.
+func (s *RangeSet) Contains(ip net.IP) bool {
+	_, r := s.RangeFor(ip)
+	return r != nil
+}
+
+// RangeFor returns the Range (and its canonicalized IP) that contains ip,
+// or nil if no Range in the set does.
+func (s *RangeSet) RangeFor(ip net.IP) (net.IP, *Range) {
+	if err := canonicalizeIP(&ip); err != nil {
+		return nil, nil
+	}
+
+	for i := range *s {
+		r := &(*s)[i]
+		if r.Contains(ip) {
+			return ip, r
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,247 @@
+// Copyright 2015 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package boltdb implements the Store interface on top of a single
+// bolt.db file shared by every network, with one bucket per network.
+// Unlike disk.Store, which does one file (and one flock) per reserved
+// IP, every read/write here goes through a bolt transaction, so it
+// scales to high churn without burning inodes.
+package boltdb
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/alexflint/go-filemutex"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/containernetworking/plugins/plugins/ipam/host-local/backend/allocator"
+)
+
+const defaultDBName = "host-local-bolt.db"
+const lastIPKeyPrefix = "last-reserved-ip:"
+
+var defaultDataDir = "/var/lib/cni/networks"
+
+// reservation is the value stored under each reserved IP's key.
+type reservation struct {
+	ContainerID string    `json:"containerID"`
+	IfName      string    `json:"ifname"`
+	Timestamp   time.Time `json:"timestamp"`
+}
+
+// Store is a bolt-backed implementation of allocator.Store. All
+// reservations for a network live in a single bucket (named after the
+// network) inside one shared bolt.db file. ReleaseByID removes all of a
+// pair's IPs in a single atomic transaction; Reserve takes one IP per
+// transaction, and reserving several IPs is not one transaction. Each
+// bolt transaction is atomic on its own, but IPAllocator.Get's idempotency check spans a GetByID read and
+// a later Reserve write as two separate transactions, so a real flock
+// (like disk.Store's) still guards that whole sequence.
+type Store struct {
+	*filemutex.FileMutex
+	db      *bolt.DB
+	network string
+}
+
+// New opens (creating if necessary) the shared bolt.db under dataDir
+// (or defaultDataDir if empty) and ensures a bucket exists for network.
+func New(network string, dataDir string) (*Store, error) {
+	if dataDir == "" {
+		dataDir = defaultDataDir
+	}
+	if err := os.MkdirAll(dataDir, 0755); err != nil {
+		return nil, err
+	}
+
+	lk, err := filemutex.New(filepath.Join(dataDir, "lock"))
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := bolt.Open(filepath.Join(dataDir, defaultDBName), 0644, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open bolt store: %v", err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte(network))
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &Store{FileMutex: lk, db: db, network: network}, nil
+}
+
+// Close closes the underlying bolt.db file and releases the lock. The
+// bolt.db error takes priority: it's the one more likely to point at an
+// actual data-persistence problem, whereas a failed Unlock just leaves a
+// stale lock file behind.
+func (s *Store) Close() error {
+	dbErr := s.db.Close()
+	unlockErr := s.Unlock()
+	if dbErr != nil {
+		return dbErr
+	}
+	return unlockErr
+}
+
+// Reserve atomically reserves ip for (id, ifname) in rangeID, returning
+// false without error if ip is already taken.
+func (s *Store) Reserve(id string, ifname string, ip net.IP, rangeID string) (bool, error) {
+	reserved := false
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(s.network))
+		key := []byte(ip.String())
+		if b.Get(key) != nil {
+			return nil
+		}
+
+		val, err := json.Marshal(reservation{ContainerID: id, IfName: ifname, Timestamp: time.Now()})
+		if err != nil {
+			return err
+		}
+		if err := b.Put(key, val); err != nil {
+			return err
+		}
+		if err := b.Put([]byte(lastIPKeyPrefix+rangeID), []byte(ip.String())); err != nil {
+			return err
+		}
+		reserved = true
+		return nil
+	})
+	return reserved, err
+}
+
+// LastReservedIP returns the last IP reserved for rangeID, or nil if
+// none has been reserved yet.
+func (s *Store) LastReservedIP(rangeID string) (net.IP, error) {
+	var ip net.IP
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(s.network))
+		v := b.Get([]byte(lastIPKeyPrefix + rangeID))
+		if v != nil {
+			ip = net.ParseIP(string(v))
+		}
+		return nil
+	})
+	return ip, err
+}
+
+// Release removes the reservation for ip, if any.
+func (s *Store) Release(ip net.IP) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(s.network)).Delete([]byte(ip.String()))
+	})
+}
+
+// ReleaseByID atomically removes every reservation belonging to (id,
+// ifname) in a single transaction.
+func (s *Store) ReleaseByID(id string, ifname string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(s.network))
+		var stale [][]byte
+		err := b.ForEach(func(k, v []byte) error {
+			if r, ok := decodeReservation(k, v); ok && r.ContainerID == id && r.IfName == ifname {
+				stale = append(stale, append([]byte(nil), k...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, k := range stale {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// FindByID reports whether the store has at least one IP reserved for
+// the given (id, ifname) pair.
+func (s *Store) FindByID(id string, ifname string) bool {
+	found := false
+	s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(s.network))
+		return b.ForEach(func(k, v []byte) error {
+			if r, ok := decodeReservation(k, v); ok && r.ContainerID == id && r.IfName == ifname {
+				found = true
+			}
+			return nil
+		})
+	})
+	return found
+}
+
+// GetByID returns every IP currently reserved for the given (id,
+// ifname) pair.
+func (s *Store) GetByID(id string, ifname string) []net.IP {
+	var ips []net.IP
+	s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(s.network))
+		return b.ForEach(func(k, v []byte) error {
+			if r, ok := decodeReservation(k, v); ok && r.ContainerID == id && r.IfName == ifname {
+				if ip := net.ParseIP(string(k)); ip != nil {
+					ips = append(ips, ip)
+				}
+			}
+			return nil
+		})
+	})
+	return ips
+}
+
+// GetReservations returns every reservation currently held by the
+// store, across all ranges.
+func (s *Store) GetReservations() ([]allocator.Reservation, error) {
+	var reservations []allocator.Reservation
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(s.network))
+		return b.ForEach(func(k, v []byte) error {
+			r, ok := decodeReservation(k, v)
+			if !ok {
+				return nil
+			}
+			reservations = append(reservations, allocator.Reservation{
+				IP:          net.ParseIP(string(k)),
+				ContainerID: r.ContainerID,
+				IfName:      r.IfName,
+			})
+			return nil
+		})
+	})
+	return reservations, err
+}
+
+// decodeReservation skips the non-reservation keys (e.g. last-reserved-ip
+// markers) that share the bucket with IP reservations.
+func decodeReservation(key, val []byte) (reservation, bool) {
+	if net.ParseIP(string(key)) == nil {
+		return reservation{}, false
+	}
+	var r reservation
+	if err := json.Unmarshal(val, &r); err != nil {
+		return reservation{}, false
+	}
+	return r, true
+}
@@ -0,0 +1,220 @@
+// Copyright 2015 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package disk implements the Store interface backed by one file per
+// reserved IP in a directory, locked with flock for process safety.
+package disk
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/alexflint/go-filemutex"
+
+	"github.com/containernetworking/plugins/plugins/ipam/host-local/backend/allocator"
+)
+
+const lastIPFilePrefix = "last_reserved_ip."
+const LineBreak = "\n"
+
+var defaultDataDir = "/var/lib/cni/networks"
+
+// Store is a disk-backed implementation of allocator.Store. Every
+// reserved IP is tracked by a file named after the IP, in a
+// per-network directory under dataDir. Each file holds two lines: the
+// ContainerID and the IfName it was reserved for, so a single container
+// can hold separate reservations on more than one interface (e.g. a
+// pod with several Multus secondary networks).
+type Store struct {
+	*filemutex.FileMutex
+	dataDir string
+}
+
+// New creates a Store for the given network, rooted at dataDir (or
+// defaultDataDir if empty). Reservation files written before per-ifname
+// tracking existed (a single ContainerID line, no IfName line) are left
+// as-is on disk: forEachReservation already treats a missing second line
+// as an empty IfName, so they keep working without being rewritten.
+func New(network string, dataDir string) (*Store, error) {
+	if dataDir == "" {
+		dataDir = defaultDataDir
+	}
+	dir := filepath.Join(dataDir, network)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	lk, err := filemutex.New(filepath.Join(dir, "lock"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Store{lk, dir}, nil
+}
+
+// Reserve writes a reservation file for ip if one doesn't already
+// exist, and records ip as the last reserved IP for rangeID.
+// It returns false, without error, if ip was already reserved.
+func (s *Store) Reserve(id string, ifname string, ip net.IP, rangeID string) (bool, error) {
+	fname := filepath.Join(s.dataDir, ip.String())
+	f, err := os.OpenFile(fname, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0644)
+	if os.IsExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	if _, err := f.WriteString(id + LineBreak + ifname + LineBreak); err != nil {
+		os.Remove(fname)
+		return false, err
+	}
+
+	if err := os.WriteFile(filepath.Join(s.dataDir, lastIPFilePrefix+rangeID), []byte(ip.String()), 0644); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// LastReservedIP returns the last IP reserved for the given rangeID, or
+// nil if none has been reserved yet.
+func (s *Store) LastReservedIP(rangeID string) (net.IP, error) {
+	data, err := os.ReadFile(filepath.Join(s.dataDir, lastIPFilePrefix+rangeID))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return net.ParseIP(string(data)), nil
+}
+
+// Release removes the reservation for ip, if any.
+func (s *Store) Release(ip net.IP) error {
+	return os.Remove(filepath.Join(s.dataDir, ip.String()))
+}
+
+// ReleaseByID removes every reservation file belonging to (id, ifname).
+// An empty ifname also matches legacy pre-per-ifname-tracking entries,
+// which have no IfName line.
+func (s *Store) ReleaseByID(id string, ifname string) error {
+	return s.forEachReservation(id, ifname, func(path string) error {
+		return os.Remove(path)
+	})
+}
+
+// FindByID reports whether the store has at least one IP reserved for
+// the given (id, ifname) pair.
+func (s *Store) FindByID(id string, ifname string) bool {
+	found := false
+	s.forEachReservation(id, ifname, func(path string) error {
+		found = true
+		return nil
+	})
+	return found
+}
+
+// GetByID returns every IP currently reserved for the given (id,
+// ifname) pair. Used by the allocator to make ADD idempotent: a retried
+// ADD for the same (container, interface) returns the existing
+// reservation instead of allocating (or erroring on) a new one.
+func (s *Store) GetByID(id string, ifname string) []net.IP {
+	var ips []net.IP
+	s.forEachReservation(id, ifname, func(path string) error {
+		if ip := net.ParseIP(filepath.Base(path)); ip != nil {
+			ips = append(ips, ip)
+		}
+		return nil
+	})
+	return ips
+}
+
+// GetReservations returns every reservation currently held by the
+// store, across all ranges.
+func (s *Store) GetReservations() ([]allocator.Reservation, error) {
+	entries, err := os.ReadDir(s.dataDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var reservations []allocator.Reservation
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		ip := net.ParseIP(entry.Name())
+		if ip == nil {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(s.dataDir, entry.Name()))
+		if err != nil {
+			continue
+		}
+
+		lines := strings.SplitN(strings.TrimRight(string(data), LineBreak), LineBreak, 2)
+		r := allocator.Reservation{IP: ip, ContainerID: lines[0]}
+		if len(lines) > 1 {
+			r.IfName = lines[1]
+		}
+		reservations = append(reservations, r)
+	}
+	return reservations, nil
+}
+
+// forEachReservation walks every reservation file in the store and
+// invokes fn for each one whose (ContainerID, IfName) lines match.
+func (s *Store) forEachReservation(id string, ifname string, fn func(path string) error) error {
+	entries, err := os.ReadDir(s.dataDir)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || net.ParseIP(entry.Name()) == nil {
+			continue
+		}
+
+		path := filepath.Join(s.dataDir, entry.Name())
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+
+		lines := strings.SplitN(strings.TrimRight(string(data), LineBreak), LineBreak, 2)
+		fileID := lines[0]
+		fileIfname := ""
+		if len(lines) > 1 {
+			fileIfname = lines[1]
+		}
+
+		if fileID != id || fileIfname != ifname {
+			continue
+		}
+
+		if err := fn(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close unlocks the store.
+func (s *Store) Close() error {
+	return s.Unlock()
+}
@@ -0,0 +1,83 @@
+// Copyright 2015 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package disk
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func newTestStore(t *testing.T) *Store {
+	t.Helper()
+
+	store, err := New("testnet", t.TempDir())
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+// TestLegacyEntryHasEmptyIfName covers a reservation file written before
+// per-ifname tracking existed: a single ContainerID line and no second
+// (IfName) line. It must still be found, released, and reported by
+// GetByID/FindByID/ReleaseByID with ifname="", without being rewritten.
+func TestLegacyEntryHasEmptyIfName(t *testing.T) {
+	store := newTestStore(t)
+
+	if err := os.WriteFile(filepath.Join(store.dataDir, "192.0.2.2"), []byte("container1"+LineBreak), 0644); err != nil {
+		t.Fatalf("seeding legacy reservation file: %v", err)
+	}
+
+	if !store.FindByID("container1", "") {
+		t.Fatal("FindByID(id, \"\") didn't match a legacy single-line reservation")
+	}
+	if store.FindByID("container1", "eth0") {
+		t.Fatal("FindByID(id, \"eth0\") matched a legacy entry that has no ifname")
+	}
+
+	ips := store.GetByID("container1", "")
+	if len(ips) != 1 || ips[0].String() != "192.0.2.2" {
+		t.Fatalf("GetByID(id, \"\") = %v, want [192.0.2.2]", ips)
+	}
+
+	if err := store.ReleaseByID("container1", ""); err != nil {
+		t.Fatalf("ReleaseByID: %v", err)
+	}
+	if store.FindByID("container1", "") {
+		t.Fatal("ReleaseByID didn't remove the legacy reservation")
+	}
+}
+
+func TestGetReservationsIncludesLegacyEntries(t *testing.T) {
+	store := newTestStore(t)
+
+	if err := os.WriteFile(filepath.Join(store.dataDir, "192.0.2.3"), []byte("container2"+LineBreak), 0644); err != nil {
+		t.Fatalf("seeding legacy reservation file: %v", err)
+	}
+
+	reservations, err := store.GetReservations()
+	if err != nil {
+		t.Fatalf("GetReservations: %v", err)
+	}
+	if len(reservations) != 1 {
+		t.Fatalf("GetReservations returned %d entries, want 1", len(reservations))
+	}
+	r := reservations[0]
+	if r.ContainerID != "container2" || r.IfName != "" || r.IP.String() != "192.0.2.3" {
+		t.Fatalf("GetReservations = %+v, want {IP: 192.0.2.3, ContainerID: container2, IfName: \"\"}", r)
+	}
+}
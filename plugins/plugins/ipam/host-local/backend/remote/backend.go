@@ -0,0 +1,293 @@
+// Copyright 2015 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package remote implements the Store interface on top of an external
+// gRPC IPAM service (see remote.proto), so several nodes can share a
+// single IP pool. That matters for macvlan in L2 mode: the pool is
+// really one broadcast domain, not something the current per-host
+// file-lock scheme (disk.Store) can partition safely.
+package remote
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"github.com/containernetworking/cni/pkg/types"
+	"github.com/containernetworking/plugins/plugins/ipam/host-local/backend/allocator"
+	"github.com/containernetworking/plugins/plugins/ipam/host-local/backend/disk"
+	"github.com/containernetworking/plugins/plugins/ipam/host-local/backend/remote/remotepb"
+)
+
+const dialTimeout = 5 * time.Second
+
+// Config is the "ipam.remote" block of the netconf.
+type Config struct {
+	Endpoint string `json:"endpoint"`
+	// TLSCACert, TLSCert and TLSKey enable TLS (and, if TLSCert/TLSKey
+	// are both set, mTLS) towards Endpoint. All are optional; with none
+	// set, the connection is plaintext.
+	TLSCACert string `json:"tlsCACert,omitempty"`
+	TLSCert   string `json:"tlsCert,omitempty"`
+	TLSKey    string `json:"tlsKey,omitempty"`
+}
+
+// Store delegates Reserve/Release/Check to an external gRPC IPAM
+// service. A disk.Store cache mirrors every reservation this node is
+// handed: FindByID (CHECK) and GetByID fall back to it if the service is
+// briefly unreachable, and LastReservedIP, Release and GetReservations
+// read or change only the cache. Reserve, ReleaseByID, FindByID and
+// GetByID go to the service first.
+type Store struct {
+	network string
+	conn    *grpc.ClientConn
+	client  remotepb.IPAMClient
+	cache   *disk.Store
+
+	routes    []*types.Route
+	dns       []string
+	rangeSets map[string]string // rangeID -> JSON-encoded allocator.RangeSet
+}
+
+// extraDialOpts lets tests point New at an in-process fake server (e.g.
+// via a bufconn dialer) without adding a test-only parameter to New's
+// public signature.
+var extraDialOpts []grpc.DialOption
+
+// New dials cfg.Endpoint and wraps it as a Store, with dataDir used for
+// the local CHECK cache.
+func New(network string, dataDir string, cfg Config) (*Store, error) {
+	cache, err := disk.New(network, dataDir)
+	if err != nil {
+		return nil, err
+	}
+
+	creds, err := transportCredentials(cfg)
+	if err != nil {
+		cache.Close()
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), dialTimeout)
+	defer cancel()
+
+	opts := append([]grpc.DialOption{grpc.WithTransportCredentials(creds), grpc.WithBlock()}, extraDialOpts...)
+	conn, err := grpc.DialContext(ctx, cfg.Endpoint, opts...)
+	if err != nil {
+		cache.Close()
+		return nil, fmt.Errorf("failed to dial remote IPAM service %s: %v", cfg.Endpoint, err)
+	}
+
+	return &Store{
+		network:   network,
+		conn:      conn,
+		client:    remotepb.NewIPAMClient(conn),
+		cache:     cache,
+		rangeSets: map[string]string{},
+	}, nil
+}
+
+func transportCredentials(cfg Config) (credentials.TransportCredentials, error) {
+	if cfg.TLSCACert == "" && cfg.TLSCert == "" && cfg.TLSKey == "" {
+		return insecure.NewCredentials(), nil
+	}
+
+	// Without TLSCACert, the system roots verify the server.
+	tlsConfig := &tls.Config{}
+	if cfg.TLSCACert != "" {
+		caCert, err := os.ReadFile(cfg.TLSCACert)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read tlsCACert %s: %v", cfg.TLSCACert, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("failed to parse tlsCACert %s", cfg.TLSCACert)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if cfg.TLSCert != "" && cfg.TLSKey != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.TLSCert, cfg.TLSKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client cert/key for mTLS: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return credentials.NewTLS(tlsConfig), nil
+}
+
+// SetHints attaches the routes/DNS/RangeSets that accompany every
+// Reserve call, so the service can apply the same policy a local
+// allocator would. Called once by cmdAdd before the per-range
+// IPAllocator loop.
+func (s *Store) SetHints(routes []*types.Route, dns []string, ranges []allocator.RangeSet) {
+	s.routes = routes
+	s.dns = dns
+	for idx, rs := range ranges {
+		if b, err := json.Marshal(rs); err == nil {
+			s.rangeSets[fmt.Sprintf("%d", idx)] = string(b)
+		}
+	}
+}
+
+func (s *Store) Lock() error   { return s.cache.Lock() }
+func (s *Store) Unlock() error { return s.cache.Unlock() }
+
+func (s *Store) Close() error {
+	cacheErr := s.cache.Close()
+	if err := s.conn.Close(); err != nil {
+		return err
+	}
+	return cacheErr
+}
+
+func (s *Store) Reserve(id string, ifname string, ip net.IP, rangeID string) (bool, error) {
+	requested := ""
+	if ip != nil {
+		requested = ip.String()
+	}
+
+	allocated, _, err := s.reserve(id, ifname, requested, rangeID)
+	if err != nil {
+		return false, err
+	}
+	return allocated != nil, nil
+}
+
+// ReserveNext asks the remote service to pick the next free IP in
+// rangeID itself, rather than having the caller guess-and-check
+// candidates from its own local, possibly-stale view of the pool. It
+// implements allocator.AutoAllocator, so IPAllocator.Get uses this
+// instead of its local rangeIter loop whenever the Store supports it.
+func (s *Store) ReserveNext(id string, ifname string, rangeID string) (net.IP, net.IP, error) {
+	return s.reserve(id, ifname, "", rangeID)
+}
+
+// reserve is the shared implementation behind Reserve and ReserveNext:
+// requestedIP is either a specific address or "" to let the service
+// choose. It returns the allocated address and its gateway.
+func (s *Store) reserve(id string, ifname string, requestedIP string, rangeID string) (net.IP, net.IP, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dialTimeout)
+	defer cancel()
+
+	var routes []*remotepb.Route
+	for _, r := range s.routes {
+		routes = append(routes, &remotepb.Route{Dst: r.Dst.String(), Gw: r.GW.String()})
+	}
+
+	var rangeIdx int32
+	fmt.Sscanf(rangeID, "%d", &rangeIdx)
+
+	resp, err := s.client.Reserve(ctx, &remotepb.ReserveRequest{
+		Network:     s.network,
+		RangeIndex:  rangeIdx,
+		RangeSet:    s.rangeSets[rangeID],
+		ContainerId: id,
+		Ifname:      ifname,
+		RequestedIp: requestedIP,
+		Routes:      routes,
+		Dns:         s.dns,
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("remote IPAM Reserve failed: %v", err)
+	}
+	if resp.Ip == nil {
+		return nil, nil, nil
+	}
+
+	allocated, _, err := net.ParseCIDR(resp.Ip.Address)
+	if err != nil {
+		return nil, nil, fmt.Errorf("remote IPAM returned invalid address %q: %v", resp.Ip.Address, err)
+	}
+	gw := net.ParseIP(resp.Ip.Gateway)
+
+	// Mirror into the local cache so CHECK has an answer even if the
+	// service is briefly unreachable later.
+	if _, err := s.cache.Reserve(id, ifname, allocated, rangeID); err != nil {
+		return nil, nil, err
+	}
+	return allocated, gw, nil
+}
+
+func (s *Store) LastReservedIP(rangeID string) (net.IP, error) {
+	// The service, not this node, decides the next IP; the cache only
+	// needs to track what *this* node has already been handed.
+	return s.cache.LastReservedIP(rangeID)
+}
+
+func (s *Store) Release(ip net.IP) error {
+	return s.cache.Release(ip)
+}
+
+func (s *Store) ReleaseByID(id string, ifname string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dialTimeout)
+	defer cancel()
+
+	if _, err := s.client.Release(ctx, &remotepb.ReleaseRequest{
+		Network: s.network, ContainerId: id, Ifname: ifname,
+	}); err != nil {
+		return fmt.Errorf("remote IPAM Release failed: %v", err)
+	}
+
+	return s.cache.ReleaseByID(id, ifname)
+}
+
+// FindByID asks the remote service first; if it's unreachable, CHECK
+// falls back to the local cache so it still works offline.
+func (s *Store) FindByID(id string, ifname string) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), dialTimeout)
+	defer cancel()
+
+	resp, err := s.client.Check(ctx, &remotepb.CheckRequest{Network: s.network, ContainerId: id, Ifname: ifname})
+	if err == nil {
+		return resp.Found
+	}
+	return s.cache.FindByID(id, ifname)
+}
+
+// GetByID asks the remote service first, so IPAllocator.Get's
+// idempotency check (a retried ADD must return the existing
+// reservation, not allocate a second one) still works when the retry
+// lands on a different node, or this node's cache was wiped. It falls
+// back to the local cache only if the service is unreachable.
+func (s *Store) GetByID(id string, ifname string) []net.IP {
+	ctx, cancel := context.WithTimeout(context.Background(), dialTimeout)
+	defer cancel()
+
+	resp, err := s.client.Lookup(ctx, &remotepb.LookupRequest{Network: s.network, ContainerId: id, Ifname: ifname})
+	if err != nil {
+		return s.cache.GetByID(id, ifname)
+	}
+
+	var ips []net.IP
+	for _, ipConf := range resp.Ips {
+		if ip, _, err := net.ParseCIDR(ipConf.Address); err == nil {
+			ips = append(ips, ip)
+		}
+	}
+	return ips
+}
+
+func (s *Store) GetReservations() ([]allocator.Reservation, error) {
+	return s.cache.GetReservations()
+}
@@ -0,0 +1,152 @@
+// Copyright 2015 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/containernetworking/plugins/plugins/ipam/host-local/backend/remote/remotepb"
+)
+
+const testBufSize = 1024 * 1024
+
+// fakeIPAMServer is a minimal in-memory stand-in for the external gRPC
+// IPAM service: just enough to round-trip Reserve/Release/Check/Lookup
+// over a real (in-process) gRPC connection, to catch exactly the kind
+// of wire-format bug (hand-written structs that don't implement
+// proto.Message) that a mocked Store interface never would.
+type fakeIPAMServer struct {
+	reservations map[string]*remotepb.IPConfig // key: containerID+"/"+ifname
+	next         int
+}
+
+func newFakeIPAMServer() *fakeIPAMServer {
+	return &fakeIPAMServer{reservations: map[string]*remotepb.IPConfig{}}
+}
+
+func reservationKey(id, ifname string) string { return id + "/" + ifname }
+
+func (f *fakeIPAMServer) Reserve(ctx context.Context, req *remotepb.ReserveRequest) (*remotepb.ReserveResponse, error) {
+	k := reservationKey(req.ContainerId, req.Ifname)
+	if ip, ok := f.reservations[k]; ok {
+		return &remotepb.ReserveResponse{Ip: ip}, nil
+	}
+
+	addr := req.RequestedIp
+	if addr == "" {
+		f.next++
+		addr = fmt.Sprintf("192.0.2.%d", f.next+1)
+	}
+	ip := &remotepb.IPConfig{Version: "4", Address: addr + "/24", Gateway: "192.0.2.1"}
+	f.reservations[k] = ip
+	return &remotepb.ReserveResponse{Ip: ip}, nil
+}
+
+func (f *fakeIPAMServer) Release(ctx context.Context, req *remotepb.ReleaseRequest) (*remotepb.ReleaseResponse, error) {
+	delete(f.reservations, reservationKey(req.ContainerId, req.Ifname))
+	return &remotepb.ReleaseResponse{}, nil
+}
+
+func (f *fakeIPAMServer) Check(ctx context.Context, req *remotepb.CheckRequest) (*remotepb.CheckResponse, error) {
+	_, ok := f.reservations[reservationKey(req.ContainerId, req.Ifname)]
+	return &remotepb.CheckResponse{Found: ok}, nil
+}
+
+func (f *fakeIPAMServer) Lookup(ctx context.Context, req *remotepb.LookupRequest) (*remotepb.LookupResponse, error) {
+	if ip, ok := f.reservations[reservationKey(req.ContainerId, req.Ifname)]; ok {
+		return &remotepb.LookupResponse{Ips: []*remotepb.IPConfig{ip}}, nil
+	}
+	return &remotepb.LookupResponse{}, nil
+}
+
+// newTestStore wires a Store up to an in-process fakeIPAMServer over a
+// bufconn listener, so tests exercise the real grpc.ClientConn.Invoke
+// path (and therefore the json codec in remotepb/codec.go) instead of
+// calling the fake server's methods directly.
+func newTestStore(t *testing.T) *Store {
+	t.Helper()
+
+	lis := bufconn.Listen(testBufSize)
+	srv := grpc.NewServer()
+	remotepb.RegisterIPAMServer(srv, newFakeIPAMServer())
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	extraDialOpts = []grpc.DialOption{
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.Dial()
+		}),
+	}
+	t.Cleanup(func() { extraDialOpts = nil })
+
+	store, err := New("testnet", t.TempDir(), Config{Endpoint: "bufnet"})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func TestStoreReserveReleaseRoundTrip(t *testing.T) {
+	store := newTestStore(t)
+
+	reserved, err := store.Reserve("container1", "eth0", nil, "0")
+	if err != nil {
+		t.Fatalf("Reserve: %v", err)
+	}
+	if !reserved {
+		t.Fatal("Reserve: want true, got false")
+	}
+
+	if !store.FindByID("container1", "eth0") {
+		t.Fatal("FindByID: want true after Reserve")
+	}
+
+	if ips := store.GetByID("container1", "eth0"); len(ips) != 1 {
+		t.Fatalf("GetByID: want 1 IP, got %v", ips)
+	}
+
+	if err := store.ReleaseByID("container1", "eth0"); err != nil {
+		t.Fatalf("ReleaseByID: %v", err)
+	}
+
+	if store.FindByID("container1", "eth0") {
+		t.Fatal("FindByID: want false after ReleaseByID")
+	}
+	if ips := store.GetByID("container1", "eth0"); len(ips) != 0 {
+		t.Fatalf("GetByID after release: want none, got %v", ips)
+	}
+}
+
+func TestStoreReserveNext(t *testing.T) {
+	store := newTestStore(t)
+
+	ip, gw, err := store.ReserveNext("container2", "eth0", "0")
+	if err != nil {
+		t.Fatalf("ReserveNext: %v", err)
+	}
+	if ip == nil {
+		t.Fatal("ReserveNext: want a non-nil IP")
+	}
+	if gw == nil {
+		t.Fatal("ReserveNext: want a non-nil gateway")
+	}
+}
@@ -0,0 +1,125 @@
+// Package remotepb is a hand-written client/server stub for the IPAM
+// service described in remote.proto. It is not the output of
+// protoc-gen-go: these message types don't implement proto.Message, so
+// they travel over the wire via the JSON codec registered in codec.go
+// (selected per-call with grpc.CallContentSubtype), not real protobuf
+// encoding. The struct tags mirror remote.proto's field names so the
+// wire shape still matches the .proto definition.
+package remotepb
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+)
+
+type Route struct {
+	Dst string `protobuf:"bytes,1,opt,name=dst,proto3" json:"dst,omitempty"`
+	Gw  string `protobuf:"bytes,2,opt,name=gw,proto3" json:"gw,omitempty"`
+}
+
+type ReserveRequest struct {
+	Network     string   `protobuf:"bytes,1,opt,name=network,proto3" json:"network,omitempty"`
+	RangeIndex  int32    `protobuf:"varint,2,opt,name=range_index,proto3" json:"range_index,omitempty"`
+	RangeSet    string   `protobuf:"bytes,3,opt,name=range_set,proto3" json:"range_set,omitempty"`
+	ContainerId string   `protobuf:"bytes,4,opt,name=container_id,proto3" json:"container_id,omitempty"`
+	Ifname      string   `protobuf:"bytes,5,opt,name=ifname,proto3" json:"ifname,omitempty"`
+	RequestedIp string   `protobuf:"bytes,6,opt,name=requested_ip,proto3" json:"requested_ip,omitempty"`
+	Routes      []*Route `protobuf:"bytes,7,rep,name=routes,proto3" json:"routes,omitempty"`
+	Dns         []string `protobuf:"bytes,8,rep,name=dns,proto3" json:"dns,omitempty"`
+}
+
+type IPConfig struct {
+	Version string `protobuf:"bytes,1,opt,name=version,proto3" json:"version,omitempty"`
+	Address string `protobuf:"bytes,2,opt,name=address,proto3" json:"address,omitempty"`
+	Gateway string `protobuf:"bytes,3,opt,name=gateway,proto3" json:"gateway,omitempty"`
+}
+
+type ReserveResponse struct {
+	Ip *IPConfig `protobuf:"bytes,1,opt,name=ip,proto3" json:"ip,omitempty"`
+}
+
+type ReleaseRequest struct {
+	Network     string `protobuf:"bytes,1,opt,name=network,proto3" json:"network,omitempty"`
+	ContainerId string `protobuf:"bytes,2,opt,name=container_id,proto3" json:"container_id,omitempty"`
+	Ifname      string `protobuf:"bytes,3,opt,name=ifname,proto3" json:"ifname,omitempty"`
+}
+
+type ReleaseResponse struct{}
+
+type CheckRequest struct {
+	Network     string `protobuf:"bytes,1,opt,name=network,proto3" json:"network,omitempty"`
+	ContainerId string `protobuf:"bytes,2,opt,name=container_id,proto3" json:"container_id,omitempty"`
+	Ifname      string `protobuf:"bytes,3,opt,name=ifname,proto3" json:"ifname,omitempty"`
+}
+
+type CheckResponse struct {
+	Found bool `protobuf:"varint,1,opt,name=found,proto3" json:"found,omitempty"`
+}
+
+type LookupRequest struct {
+	Network     string `protobuf:"bytes,1,opt,name=network,proto3" json:"network,omitempty"`
+	ContainerId string `protobuf:"bytes,2,opt,name=container_id,proto3" json:"container_id,omitempty"`
+	Ifname      string `protobuf:"bytes,3,opt,name=ifname,proto3" json:"ifname,omitempty"`
+}
+
+type LookupResponse struct {
+	Ips []*IPConfig `protobuf:"bytes,1,rep,name=ips,proto3" json:"ips,omitempty"`
+}
+
+// IPAMClient is the client API for the IPAM service.
+type IPAMClient interface {
+	Reserve(ctx context.Context, in *ReserveRequest, opts ...grpc.CallOption) (*ReserveResponse, error)
+	Release(ctx context.Context, in *ReleaseRequest, opts ...grpc.CallOption) (*ReleaseResponse, error)
+	Check(ctx context.Context, in *CheckRequest, opts ...grpc.CallOption) (*CheckResponse, error)
+	Lookup(ctx context.Context, in *LookupRequest, opts ...grpc.CallOption) (*LookupResponse, error)
+}
+
+type ipamClient struct {
+	cc grpc.ClientConnInterface
+}
+
+// NewIPAMClient wraps a dialed gRPC connection in the IPAM client stub.
+func NewIPAMClient(cc grpc.ClientConnInterface) IPAMClient {
+	return &ipamClient{cc}
+}
+
+// withCodec puts the json codec (codec.go) after any caller-supplied
+// options, so every call goes out JSON-encoded regardless of what the
+// caller passes: grpc applies call options in order, and the last
+// content subtype wins.
+func withCodec(opts []grpc.CallOption) []grpc.CallOption {
+	return append(append([]grpc.CallOption{}, opts...), grpc.CallContentSubtype(codecName))
+}
+
+func (c *ipamClient) Reserve(ctx context.Context, in *ReserveRequest, opts ...grpc.CallOption) (*ReserveResponse, error) {
+	out := new(ReserveResponse)
+	if err := c.cc.Invoke(ctx, "/remote.IPAM/Reserve", in, out, withCodec(opts)...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *ipamClient) Release(ctx context.Context, in *ReleaseRequest, opts ...grpc.CallOption) (*ReleaseResponse, error) {
+	out := new(ReleaseResponse)
+	if err := c.cc.Invoke(ctx, "/remote.IPAM/Release", in, out, withCodec(opts)...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *ipamClient) Check(ctx context.Context, in *CheckRequest, opts ...grpc.CallOption) (*CheckResponse, error) {
+	out := new(CheckResponse)
+	if err := c.cc.Invoke(ctx, "/remote.IPAM/Check", in, out, withCodec(opts)...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *ipamClient) Lookup(ctx context.Context, in *LookupRequest, opts ...grpc.CallOption) (*LookupResponse, error) {
+	out := new(LookupResponse)
+	if err := c.cc.Invoke(ctx, "/remote.IPAM/Lookup", in, out, withCodec(opts)...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
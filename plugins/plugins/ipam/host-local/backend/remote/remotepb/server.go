@@ -0,0 +1,110 @@
+// Copyright 2015 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remotepb
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+)
+
+// IPAMServer is the server API for the IPAM service: whatever process
+// backs remote.Store implements this. Also used by tests to stand up a
+// fake server that remote.Store can dial against.
+type IPAMServer interface {
+	Reserve(context.Context, *ReserveRequest) (*ReserveResponse, error)
+	Release(context.Context, *ReleaseRequest) (*ReleaseResponse, error)
+	Check(context.Context, *CheckRequest) (*CheckResponse, error)
+	Lookup(context.Context, *LookupRequest) (*LookupResponse, error)
+}
+
+// RegisterIPAMServer registers srv as the handler for the IPAM service
+// on s.
+func RegisterIPAMServer(s grpc.ServiceRegistrar, srv IPAMServer) {
+	s.RegisterService(&ipamServiceDesc, srv)
+}
+
+func _IPAM_Reserve_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReserveRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(IPAMServer).Reserve(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/remote.IPAM/Reserve"}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(IPAMServer).Reserve(ctx, req.(*ReserveRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _IPAM_Release_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReleaseRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(IPAMServer).Release(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/remote.IPAM/Release"}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(IPAMServer).Release(ctx, req.(*ReleaseRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _IPAM_Check_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CheckRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(IPAMServer).Check(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/remote.IPAM/Check"}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(IPAMServer).Check(ctx, req.(*CheckRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _IPAM_Lookup_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(LookupRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(IPAMServer).Lookup(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/remote.IPAM/Lookup"}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(IPAMServer).Lookup(ctx, req.(*LookupRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var ipamServiceDesc = grpc.ServiceDesc{
+	ServiceName: "remote.IPAM",
+	HandlerType: (*IPAMServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "Reserve", Handler: _IPAM_Reserve_Handler},
+		{MethodName: "Release", Handler: _IPAM_Release_Handler},
+		{MethodName: "Check", Handler: _IPAM_Check_Handler},
+		{MethodName: "Lookup", Handler: _IPAM_Lookup_Handler},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "remote.proto",
+}
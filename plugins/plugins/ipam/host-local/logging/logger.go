@@ -0,0 +1,218 @@
+// Copyright 2015 CNI authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package logging provides the host-local plugin's structured logger.
+// Unlike the fixed /var/log/{add,del}_local_host.log files it replaces,
+// the sink, level and format are all configured from the netconf, and
+// default to stderr so the plugin keeps working on read-only root
+// filesystems and in rootless podman setups.
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Level is the minimum severity a Logger will emit.
+type Level int
+
+const (
+	LevelError Level = iota
+	LevelInfo
+	LevelDebug
+)
+
+// ParseLevel maps a netconf "logLevel" string to a Level, defaulting to
+// LevelInfo for an empty or unrecognized value.
+func ParseLevel(s string) Level {
+	switch s {
+	case "error":
+		return LevelError
+	case "debug":
+		return LevelDebug
+	default:
+		return LevelInfo
+	}
+}
+
+func (l Level) String() string {
+	switch l {
+	case LevelError:
+		return "error"
+	case LevelDebug:
+		return "debug"
+	default:
+		return "info"
+	}
+}
+
+// Config is the logging-related subset of the IPAM netconf.
+type Config struct {
+	File string // path to log to; "" means stderr
+	Level string
+	Format string // "text" (default) or "json"
+	// MaxSizeBytes rotates File once it grows past this size. Zero
+	// disables rotation. Ignored when File is empty.
+	MaxSizeBytes int64
+}
+
+// Record is one structured log entry for a single CNI invocation.
+type Record struct {
+	Time         time.Time `json:"time"`
+	Level        string    `json:"level"`
+	Command      string    `json:"command"` // ADD, DEL, CHECK
+	ContainerID  string    `json:"containerID,omitempty"`
+	IfName       string    `json:"ifname,omitempty"`
+	Netns        string    `json:"netns,omitempty"`
+	RequestedIPs []string  `json:"requestedIPs,omitempty"`
+	AllocatedIPs []string  `json:"allocatedIPs,omitempty"`
+	Error        string    `json:"error,omitempty"`
+	Message      string    `json:"message,omitempty"`
+}
+
+// Logger writes Records to a configured sink, as either single-line
+// JSON objects or a human-readable text line, gated by Level.
+type Logger struct {
+	mu     sync.Mutex
+	out    io.Writer
+	file   *os.File
+	path   string
+	level  Level
+	isJSON bool
+	maxSz  int64
+	size   int64
+}
+
+// New builds a Logger from cfg. File == "" logs to stderr.
+func New(cfg Config) (*Logger, error) {
+	l := &Logger{
+		level:  ParseLevel(cfg.Level),
+		isJSON: cfg.Format == "json",
+		maxSz:  cfg.MaxSizeBytes,
+		path:   cfg.File,
+	}
+
+	if cfg.File == "" {
+		l.out = os.Stderr
+		return l, nil
+	}
+
+	if err := l.openFile(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *Logger) openFile() error {
+	f, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open log file %s: %v", l.path, err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	l.file = f
+	l.out = f
+	l.size = info.Size()
+	return nil
+}
+
+// Log emits rec if rec's severity meets the configured Level.
+func (l *Logger) Log(level Level, rec Record) {
+	if level > l.level {
+		return
+	}
+
+	rec.Time = time.Now()
+	rec.Level = level.String()
+
+	var line []byte
+	if l.isJSON {
+		b, err := json.Marshal(rec)
+		if err != nil {
+			return
+		}
+		line = append(b, '\n')
+	} else {
+		line = []byte(textLine(rec))
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file != nil && l.maxSz > 0 && l.size+int64(len(line)) > l.maxSz {
+		if err := l.rotate(); err != nil {
+			// Fall back to writing anyway; a rotation failure shouldn't
+			// take down the plugin's own logging.
+			_, _ = l.out.Write(line)
+			return
+		}
+	}
+
+	n, _ := l.out.Write(line)
+	l.size += int64(n)
+}
+
+func textLine(rec Record) string {
+	s := fmt.Sprintf("%s [%s] %s containerID=%s ifname=%s netns=%s",
+		rec.Time.Format(time.RFC3339), rec.Level, rec.Command, rec.ContainerID, rec.IfName, rec.Netns)
+	if len(rec.RequestedIPs) > 0 {
+		s += fmt.Sprintf(" requested=%v", rec.RequestedIPs)
+	}
+	if len(rec.AllocatedIPs) > 0 {
+		s += fmt.Sprintf(" allocated=%v", rec.AllocatedIPs)
+	}
+	if rec.Error != "" {
+		s += fmt.Sprintf(" error=%q", rec.Error)
+	}
+	if rec.Message != "" {
+		s += " " + rec.Message
+	}
+	return s + "\n"
+}
+
+// rotate renames the current log file aside with a timestamp suffix and
+// opens a fresh one in its place. Caller must hold l.mu. The old file
+// is closed only once the new one is open, so on failure l.out still
+// accepts writes.
+func (l *Logger) rotate() error {
+	rotated := fmt.Sprintf("%s.%s", l.path, time.Now().Format("20060102T150405"))
+	if err := os.Rename(l.path, rotated); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	f, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	l.file.Close()
+	l.file = f
+	l.out = f
+	l.size = 0
+	return nil
+}
+
+// Close closes the underlying log file, if any (stderr is left open).
+func (l *Logger) Close() error {
+	if l.file == nil {
+		return nil
+	}
+	return l.file.Close()
+}
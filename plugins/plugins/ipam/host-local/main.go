@@ -17,14 +17,15 @@ package main
 import (
 	"encoding/json"
 	"fmt"
-	"log"
 	"net"
-	"os"
 	"strings"
 
 	bv "github.com/containernetworking/plugins/pkg/utils/buildversion"
 	"github.com/containernetworking/plugins/plugins/ipam/host-local/backend/allocator"
+	"github.com/containernetworking/plugins/plugins/ipam/host-local/backend/boltdb"
 	"github.com/containernetworking/plugins/plugins/ipam/host-local/backend/disk"
+	"github.com/containernetworking/plugins/plugins/ipam/host-local/backend/remote"
+	"github.com/containernetworking/plugins/plugins/ipam/host-local/logging"
 
 	"github.com/containernetworking/cni/pkg/skel"
 	"github.com/containernetworking/cni/pkg/types"
@@ -32,13 +33,6 @@ import (
 	"github.com/containernetworking/cni/pkg/version"
 )
 
-const (
-	AddLocalHostLog = "/var/log/add_local_host.log"
-	DelLocalHostLog = "/var/log/del_local_host.log"
-)
-
-var DebugLog *log.Logger
-
 func main() {
 	skel.PluginMain(cmdAdd, cmdCheck, cmdDel, version.All, bv.BuildString("host-local"))
 }
@@ -51,6 +45,40 @@ func loadNetConf(bytes []byte) (*types.NetConf, string, error) {
 	return n, n.CNIVersion, nil
 }
 
+// newStore opens the Store backend selected by the netconf: an external
+// gRPC service if ipamConf.Remote.Endpoint is set, otherwise
+// ipamConf.Backend ("disk" by default, "bolt" for the bolt.db-backed
+// implementation).
+func newStore(ipamConf *allocator.IPAMConfig) (allocator.Store, error) {
+	if ipamConf.Remote != nil && ipamConf.Remote.Endpoint != "" {
+		return remote.New(ipamConf.Name, ipamConf.DataDir, remote.Config{
+			Endpoint:  ipamConf.Remote.Endpoint,
+			TLSCACert: ipamConf.Remote.TLSCACert,
+			TLSCert:   ipamConf.Remote.TLSCert,
+			TLSKey:    ipamConf.Remote.TLSKey,
+		})
+	}
+
+	switch ipamConf.Backend {
+	case "bolt":
+		return boltdb.New(ipamConf.Name, ipamConf.DataDir)
+	default:
+		return disk.New(ipamConf.Name, ipamConf.DataDir)
+	}
+}
+
+// newLogger builds the structured logger configured on the IPAM netconf,
+// defaulting to stderr so the plugin keeps working on read-only root
+// filesystems and in rootless podman setups.
+func newLogger(ipamConf *allocator.IPAMConfig) (*logging.Logger, error) {
+	return logging.New(logging.Config{
+		File:         ipamConf.LogFile,
+		Level:        ipamConf.LogLevel,
+		Format:       ipamConf.LogFormat,
+		MaxSizeBytes: ipamConf.LogMaxSize,
+	})
+}
+
 func cmdCheck(args *skel.CmdArgs) error {
 
 	ipamConf, _, err := allocator.LoadIPAMConfig(args.StdinData, args.Args)
@@ -58,66 +86,81 @@ func cmdCheck(args *skel.CmdArgs) error {
 		return err
 	}
 
+	logger, err := newLogger(ipamConf)
+	if err != nil {
+		return err
+	}
+	defer logger.Close()
+
 	// Look to see if there is at least one IP address allocated to the container
 	// in the data dir, irrespective of what that address actually is
-	store, err := disk.New(ipamConf.Name, ipamConf.DataDir)
+	store, err := newStore(ipamConf)
 	if err != nil {
 		return err
 	}
 	defer store.Close()
 
 	containerIpFound := store.FindByID(args.ContainerID, args.IfName)
-	if containerIpFound == false {
-		return fmt.Errorf("host-local: Failed to find address added by container %v", args.ContainerID)
+	if !containerIpFound {
+		err := fmt.Errorf("host-local: Failed to find address added by container %v", args.ContainerID)
+		logger.Log(logging.LevelError, logging.Record{
+			Command: "CHECK", ContainerID: args.ContainerID, IfName: args.IfName, Netns: args.Netns, Error: err.Error(),
+		})
+		return err
 	}
 
+	logger.Log(logging.LevelDebug, logging.Record{
+		Command: "CHECK", ContainerID: args.ContainerID, IfName: args.IfName, Netns: args.Netns,
+	})
 	return nil
 }
 
 func cmdAdd(args *skel.CmdArgs) error {
 
-	fileName := AddLocalHostLog
-	logFile, err := os.OpenFile(fileName, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	ipamConf, confVersion, err := allocator.LoadIPAMConfig(args.StdinData, args.Args)
 	if err != nil {
-		logFile, err = os.Create(fileName)
+		return err
 	}
-	defer logFile.Close()
 
-	DebugLog = log.New(logFile, "[Debug]", log.LstdFlags)
-	log.SetFlags(log.LstdFlags | log.Lshortfile)
-
-	DebugLog.Println("read input from ContainerID:", args.ContainerID)
-	DebugLog.Println("read input from Netns:", args.Netns)
-	DebugLog.Println("read input from IfName:", args.IfName)
-	DebugLog.Println("read input from Args:", args.Args)
-	DebugLog.Println("read input from Path:", args.Path)
-	DebugLog.Println("read input from StdinData:", string(args.StdinData))
-
-	ipamConf, confVersion, err := allocator.LoadIPAMConfig(args.StdinData, args.Args)
+	logger, err := newLogger(ipamConf)
 	if err != nil {
 		return err
 	}
+	defer logger.Close()
 
-	DebugLog.Println("allocator.LoadIPAMConfig confVersion", confVersion)
-	DebugLog.Println("allocator.LoadIPAMConfig  IPAMConfig", *ipamConf)
+	logger.Log(logging.LevelDebug, logging.Record{
+		Command: "ADD", ContainerID: args.ContainerID, IfName: args.IfName, Netns: args.Netns,
+		Message: fmt.Sprintf("confVersion=%s stdin=%s", confVersion, string(args.StdinData)),
+	})
 
 	result := &current.Result{}
 
 	if ipamConf.ResolvConf != "" {
-		DebugLog.Println(" ipamConf.ResolvConf != \"\" ")
 		dns, err := parseResolvConf(ipamConf.ResolvConf)
 		if err != nil {
 			return err
 		}
 		result.DNS = *dns
 	}
-	DebugLog.Println("disk.New ", ipamConf.Name, "datadir:", ipamConf.DataDir)
-	store, err := disk.New(ipamConf.Name, ipamConf.DataDir)
+
+	store, err := newStore(ipamConf)
 	if err != nil {
 		return err
 	}
 	defer store.Close()
 
+	if remoteStore, ok := store.(*remote.Store); ok {
+		remoteStore.SetHints(ipamConf.Routes, result.DNS.Nameservers, ipamConf.Ranges)
+	}
+
+	var liveContainers []allocator.LiveContainer
+	if ipamConf.GCOnAdd {
+		liveContainers, err = allocator.LoadLiveContainers(ipamConf, args.Args)
+		if err != nil {
+			return fmt.Errorf("failed to load live sandbox set: %v", err)
+		}
+	}
+
 	// Keep the allocators we used, so we can release all IPs if an error
 	// occurs after we start allocating
 	allocs := []*allocator.IPAllocator{}
@@ -125,15 +168,22 @@ func cmdAdd(args *skel.CmdArgs) error {
 	// Store all requested IPs in a map, so we can easily remove ones we use
 	// and error if some remain
 	requestedIPs := map[string]net.IP{} //net.IP cannot be a key
+	var requestedStrs []string
 
 	for _, ip := range ipamConf.IPArgs {
 		requestedIPs[ip.String()] = ip
-		DebugLog.Println("for _, ip := range ipamConf.IPArgs ", ip.String(), " ip", ip)
+		requestedStrs = append(requestedStrs, ip.String())
 	}
 
 	for idx, rangeset := range ipamConf.Ranges {
 		allocator := allocator.NewIPAllocator(&rangeset, store, idx)
 
+		if ipamConf.GCOnAdd {
+			if err := allocator.GC(liveContainers, args.ContainerID, args.IfName); err != nil {
+				return fmt.Errorf("failed to GC stale reservations for range %d: %v", idx, err)
+			}
+		}
+
 		// Check to see if there are any custom IPs requested in this range.
 		var requestedIP net.IP
 		for k, ip := range requestedIPs {
@@ -150,7 +200,12 @@ func cmdAdd(args *skel.CmdArgs) error {
 			for _, alloc := range allocs {
 				_ = alloc.Release(args.ContainerID, args.IfName)
 			}
-			return fmt.Errorf("failed to allocate for range %d: %v", idx, err)
+			err = fmt.Errorf("failed to allocate for range %d: %v", idx, err)
+			logger.Log(logging.LevelError, logging.Record{
+				Command: "ADD", ContainerID: args.ContainerID, IfName: args.IfName, Netns: args.Netns,
+				RequestedIPs: requestedStrs, Error: err.Error(),
+			})
+			return err
 		}
 
 		allocs = append(allocs, allocator)
@@ -167,48 +222,45 @@ func cmdAdd(args *skel.CmdArgs) error {
 		for _, ip := range requestedIPs {
 			errstr = errstr + " " + ip.String()
 		}
-		return fmt.Errorf(errstr)
+		err := fmt.Errorf(errstr)
+		logger.Log(logging.LevelError, logging.Record{
+			Command: "ADD", ContainerID: args.ContainerID, IfName: args.IfName, Netns: args.Netns,
+			RequestedIPs: requestedStrs, Error: err.Error(),
+		})
+		return err
 	}
 
 	result.Routes = ipamConf.Routes
 
-	/*
-
-		type Result struct {
-			CNIVersion string         `json:"cniVersion,omitempty"`
-			Interfaces []*Interface   `json:"interfaces,omitempty"`
-			IPs        []*IPConfig    `json:"ips,omitempty"`
-			Routes     []*types.Route `json:"routes,omitempty"`
-			DNS        types.DNS      `json:"dns,omitempty"`
-		}
-	*/
-
-	newResult, err := result.GetAsVersion(confVersion)
-	if err != nil {
+	if _, err := result.GetAsVersion(confVersion); err != nil {
 		return err
 	}
-	//types.xxx
-	DebugLog.Println("newResult  ", newResult.String())
+
+	var allocatedStrs []string
+	for _, ip := range result.IPs {
+		allocatedStrs = append(allocatedStrs, ip.Address.String())
+	}
+	logger.Log(logging.LevelInfo, logging.Record{
+		Command: "ADD", ContainerID: args.ContainerID, IfName: args.IfName, Netns: args.Netns,
+		RequestedIPs: requestedStrs, AllocatedIPs: allocatedStrs,
+	})
 
 	return types.PrintResult(result, confVersion)
 }
 
 func cmdDel(args *skel.CmdArgs) error {
-	fileName := DelLocalHostLog
-	logFile, err := os.OpenFile(fileName, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	ipamConf, _, err := allocator.LoadIPAMConfig(args.StdinData, args.Args)
 	if err != nil {
-		logFile, err = os.Create(fileName)
+		return err
 	}
-	defer logFile.Close()
-	DebugLog = log.New(logFile, "[Debug]", log.LstdFlags)
-	log.SetFlags(log.LstdFlags | log.Lshortfile)
 
-	ipamConf, _, err := allocator.LoadIPAMConfig(args.StdinData, args.Args)
+	logger, err := newLogger(ipamConf)
 	if err != nil {
 		return err
 	}
+	defer logger.Close()
 
-	store, err := disk.New(ipamConf.Name, ipamConf.DataDir)
+	store, err := newStore(ipamConf)
 	if err != nil {
 		return err
 	}
@@ -226,7 +278,15 @@ func cmdDel(args *skel.CmdArgs) error {
 	}
 
 	if errors != nil {
-		return fmt.Errorf(strings.Join(errors, ";"))
+		err := fmt.Errorf(strings.Join(errors, ";"))
+		logger.Log(logging.LevelError, logging.Record{
+			Command: "DEL", ContainerID: args.ContainerID, IfName: args.IfName, Netns: args.Netns, Error: err.Error(),
+		})
+		return err
 	}
+
+	logger.Log(logging.LevelInfo, logging.Record{
+		Command: "DEL", ContainerID: args.ContainerID, IfName: args.IfName, Netns: args.Netns,
+	})
 	return nil
 }